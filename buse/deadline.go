@@ -0,0 +1,63 @@
+package buse
+
+import (
+	"sync"
+	"time"
+)
+
+// deadlineTimer arms a single callback to fire once after a duration,
+// and can be reset arbitrarily many times before then. It mirrors the
+// netstack deadlineTimer pattern: a shared cancel channel is closed when
+// the timer fires, and resetting after the timer has already fired
+// (Stop returns false) swaps in a fresh channel so that late fire can't
+// be mistaken for the new deadline expiring.
+type deadlineTimer struct {
+	mu       sync.Mutex
+	timer    *time.Timer
+	cancelCh chan struct{}
+	onFire   func()
+}
+
+func newDeadlineTimer(onFire func()) *deadlineTimer {
+	return &deadlineTimer{
+		cancelCh: make(chan struct{}),
+		onFire:   onFire,
+	}
+}
+
+// reset (re-)arms the timer to fire onFire after d, replacing whatever
+// deadline was previously set.
+func (dt *deadlineTimer) reset(d time.Duration) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if dt.timer != nil && !dt.timer.Stop() {
+		// the old timer already fired (or is in the process of firing):
+		// give it a channel of its own so its late fire doesn't get
+		// attributed to the deadline we're about to set.
+		dt.cancelCh = make(chan struct{})
+	}
+
+	cancelCh := dt.cancelCh
+	dt.timer = time.AfterFunc(d, func() {
+		dt.mu.Lock()
+		stillCurrent := cancelCh == dt.cancelCh
+		dt.mu.Unlock()
+
+		if !stillCurrent {
+			return
+		}
+		close(cancelCh)
+		dt.onFire()
+	})
+}
+
+// stop disarms the timer. Safe to call even if reset was never called.
+func (dt *deadlineTimer) stop() {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if dt.timer != nil {
+		dt.timer.Stop()
+	}
+}
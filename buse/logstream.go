@@ -0,0 +1,226 @@
+package buse
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// logStreamRingSize bounds how many chunks Replay can recover per
+// operation; older chunks are dropped, on the assumption that a client
+// that fell behind that far would rather resync than replay everything.
+const logStreamRingSize = 256
+
+// LogChunkNotification is sent for every flush of a LogStream writer.
+type LogChunkNotification struct {
+	Name string `json:"name"`
+	Seq  int64  `json:"seq"`
+	Data string `json:"data"`
+}
+
+type logChunk struct {
+	name string
+	seq  int64
+	data []byte
+}
+
+// logRing is a bounded, append-only ring buffer of chunks for one
+// operation, so a reconnecting client can Replay what it missed instead
+// of re-requesting the whole log. Sequence numbers are shared across
+// every named LogStream of the operation, so replayed chunks from
+// different logs (e.g. "install" and "patch") never collide and stay
+// ordered relative to each other.
+type logRing struct {
+	mu      sync.Mutex
+	nextSeq int64
+	chunks  []logChunk
+}
+
+func (lr *logRing) push(name string, data []byte) logChunk {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	c := logChunk{name: name, seq: lr.nextSeq, data: data}
+	lr.nextSeq++
+
+	lr.chunks = append(lr.chunks, c)
+	if len(lr.chunks) > logStreamRingSize {
+		lr.chunks = lr.chunks[len(lr.chunks)-logStreamRingSize:]
+	}
+
+	return c
+}
+
+func (lr *logRing) since(fromSeq int64) []logChunk {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	var out []logChunk
+	for _, c := range lr.chunks {
+		if c.seq >= fromSeq {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (lr *logRing) isEmpty() bool {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return len(lr.chunks) == 0
+}
+
+var logRings sync.Map // operation key (string) -> *logRing
+
+func logRingFor(key string) *logRing {
+	ringI, _ := logRings.LoadOrStore(key, &logRing{})
+	return ringI.(*logRing)
+}
+
+// ReleaseLogStreams drops this operation's buffered log chunks. Call it
+// once an operation is fully done — Replay won't find anything in memory
+// for it afterwards (only whatever .log files remain under StagingFolder),
+// but otherwise every operation's ring would live in memory for the
+// lifetime of the butler process.
+func (rc *RequestContext) ReleaseLogStreams() {
+	logRings.Delete(rc.streamKey())
+}
+
+// streamKey identifies this request's operation for the purposes of
+// LogStream/Replay: OperationID when a handler set one (it survives
+// reconnects), falling back to the JSON-RPC request id otherwise.
+func (rc *RequestContext) streamKey() string {
+	if rc.OperationID != "" {
+		return rc.OperationID
+	}
+	return rc.id
+}
+
+// logStream is the io.WriteCloser returned by LogStream. Every Write is
+// flushed immediately as a "LogChunk" notification tagged with a
+// monotonic sequence number, kept in a bounded ring buffer, and mirrored
+// to a file under StagingFolder so it can still be tailed after a butler
+// restart.
+type logStream struct {
+	rc   *RequestContext
+	name string
+	ring *logRing
+	file *os.File
+}
+
+// LogStream returns a writer for a named log (e.g. "install", "patch")
+// tied to this request's operation. Progress bars stay a fire-and-forget
+// notification; this is for the actual install/patch log lines the itch
+// UI wants to show (and reconnect to) instead of an opaque progress bar.
+func (rc *RequestContext) LogStream(name string) io.WriteCloser {
+	ls := &logStream{
+		rc:   rc,
+		name: name,
+		ring: logRingFor(rc.streamKey()),
+	}
+
+	if rc.StagingFolder != "" {
+		path := filepath.Join(rc.StagingFolder, fmt.Sprintf("%s.log", name))
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			rc.Consumer.Warnf("LogStream %s: could not persist to %s: %s", name, path, err.Error())
+		} else {
+			ls.file = f
+		}
+	}
+
+	return ls
+}
+
+func (ls *logStream) Write(p []byte) (int, error) {
+	c := ls.ring.push(ls.name, append([]byte(nil), p...))
+
+	if ls.file != nil {
+		if _, err := ls.file.Write(p); err != nil {
+			ls.rc.Consumer.Warnf("LogStream %s: could not persist chunk: %s", ls.name, err.Error())
+		}
+	}
+
+	ls.rc.Notify("LogChunk", &LogChunkNotification{
+		Name: ls.name,
+		Seq:  c.seq,
+		Data: string(p),
+	})
+
+	return len(p), nil
+}
+
+func (ls *logStream) Close() error {
+	if ls.file != nil {
+		return ls.file.Close()
+	}
+	return nil
+}
+
+// Replay re-sends every buffered LogChunk for this request's operation
+// from fromSeq onwards, letting a client that reconnected mid-operation
+// (or after a butler restart) catch up on whatever it missed. The ring
+// only lives in memory, so across a butler restart it's always empty;
+// in that case Replay falls back to the .log files LogStream mirrored
+// writes to under StagingFolder, so the operation can still be tailed.
+func (rc *RequestContext) Replay(fromSeq int64) error {
+	ring := logRingFor(rc.streamKey())
+	chunks := ring.since(fromSeq)
+
+	if len(chunks) == 0 && ring.isEmpty() && rc.StagingFolder != "" {
+		diskChunks, err := rc.replayFromDisk(fromSeq)
+		if err != nil {
+			return err
+		}
+		chunks = diskChunks
+	}
+
+	for _, c := range chunks {
+		err := rc.Notify("LogChunk", &LogChunkNotification{
+			Name: c.name,
+			Seq:  c.seq,
+			Data: string(c.data),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayFromDisk reconstructs chunks from the .log files LogStream
+// mirrors writes to under StagingFolder, for when the in-memory ring has
+// nothing buffered — typically because butler restarted since the
+// operation was started, so logRingFor just handed back a fresh ring.
+// The original per-Write boundaries and sequence numbers don't survive a
+// restart either, so each file is replayed whole, as a single chunk
+// numbered from fromSeq onwards.
+func (rc *RequestContext) replayFromDisk(fromSeq int64) ([]logChunk, error) {
+	matches, err := filepath.Glob(filepath.Join(rc.StagingFolder, "*.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []logChunk
+	seq := fromSeq
+	for _, path := range matches {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			rc.Consumer.Warnf("Replay: could not read %s: %s", path, err.Error())
+			continue
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), ".log")
+		chunks = append(chunks, logChunk{name: name, seq: seq, data: data})
+		seq++
+	}
+
+	return chunks, nil
+}
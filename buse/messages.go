@@ -0,0 +1,106 @@
+package buse
+
+import (
+	"time"
+
+	itchio "github.com/itchio/go-itchio"
+)
+
+// OperationStartParams is the payload of "Operation.Start", the single
+// request that drives every install/uninstall/update/verify/heal: the
+// Operation field picks which one, and the matching *Params field (e.g.
+// InstallParams for "install") carries that operation's own arguments.
+type OperationStartParams struct {
+	// ID identifies this operation so it can be cancelled later via
+	// "Operation.Cancel", and so its log streams can be replayed across
+	// a reconnect (see RequestContext.LogStream/Replay). Optional: an
+	// operation started without one can't be cancelled or replayed by
+	// id, only by closing the connection.
+	ID string `json:"id,omitempty"`
+
+	StagingFolder string `json:"stagingFolder"`
+	Operation     string `json:"operation"`
+
+	// Deadline, if set, cancels the operation if it hasn't finished by
+	// then (see RequestContext.SetDeadline).
+	Deadline *time.Time `json:"deadline,omitempty"`
+
+	// IdleTimeout, in seconds, cancels the operation if it goes that
+	// long without a Notify, Call, or progress event (see
+	// RequestContext.SetIdleTimeout). Zero (the default) means no idle
+	// timeout.
+	IdleTimeout float64 `json:"idleTimeout,omitempty"`
+
+	InstallParams   *InstallParams   `json:"installParams,omitempty"`
+	UninstallParams *UninstallParams `json:"uninstallParams,omitempty"`
+	VerifyParams    *VerifyParams    `json:"verifyParams,omitempty"`
+	HealParams      *HealParams      `json:"healParams,omitempty"`
+}
+
+// OperationResult is the result of "Operation.Start". Success is always
+// set; exactly one of the other fields is set too, matching whichever
+// operation was requested.
+type OperationResult struct {
+	Success bool `json:"success"`
+
+	InstallResult   *InstallResult   `json:"installResult,omitempty"`
+	UninstallResult *UninstallResult `json:"uninstallResult,omitempty"`
+	VerifyResult    *VerifyResult    `json:"verifyResult,omitempty"`
+	HealResult      *HealResult      `json:"healResult,omitempty"`
+}
+
+// InstallParams carries what "install" (and "update", which falls back to
+// it) needs: which game/upload/build to install, and where.
+type InstallParams struct {
+	Game   *itchio.Game   `json:"game"`
+	Upload *itchio.Upload `json:"upload"`
+	Build  *itchio.Build  `json:"build"`
+
+	InstallFolder string `json:"installFolder"`
+}
+
+// InstallResult is the result of an "install" (or "update").
+type InstallResult struct {
+	Game   *itchio.Game   `json:"game"`
+	Upload *itchio.Upload `json:"upload"`
+	Build  *itchio.Build  `json:"build"`
+	Files  []string       `json:"files"`
+}
+
+// UninstallParams carries what "uninstall" needs: where the previous
+// install lives, so its files and receipt can be removed.
+type UninstallParams struct {
+	InstallFolder string `json:"installFolder"`
+}
+
+// UninstallResult is the result of an "uninstall". It carries nothing
+// yet, but is its own type (rather than nil/struct{}) so a field can be
+// added later without changing OperationResult's shape.
+type UninstallResult struct {
+}
+
+// VerifyParams carries what "verify" needs: the install to rehash
+// against its receipt.
+type VerifyParams struct {
+	InstallFolder string `json:"installFolder"`
+}
+
+// VerifyResult is the result of a "verify": every file the receipt
+// expected but didn't find, and every file that was found but didn't
+// hash the way the receipt expected.
+type VerifyResult struct {
+	MissingFiles    []string `json:"missingFiles,omitempty"`
+	MismatchedFiles []string `json:"mismatchedFiles,omitempty"`
+}
+
+// HealParams carries what "heal" needs: the install to verify, then
+// re-fetch whatever doesn't check out.
+type HealParams struct {
+	InstallFolder string `json:"installFolder"`
+}
+
+// HealResult is the result of a "heal": every file that was missing or
+// mismatched and has since been re-fetched.
+type HealResult struct {
+	HealedFiles []string `json:"healedFiles,omitempty"`
+}
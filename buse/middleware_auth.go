@@ -0,0 +1,70 @@
+package buse
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"sync"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// AuthAllowList is the set of methods a connection may call before it has
+// authenticated.
+type AuthAllowList map[string]bool
+
+type authHandshakeParams struct {
+	Authorization string `json:"Authorization"`
+}
+
+// AuthMiddleware gates every method not in allow behind a shared secret.
+// The secret is expected as the "Authorization" field of the params of
+// the first request on a connection (conventionally a handshake
+// notification); once it matches, every later request on that same
+// connection is let through without re-checking. This is meant for
+// exposing butler's buse socket to a less-trusted local UI, mirroring the
+// bridge/authentication pattern portmaster's base/api uses for its own
+// local API.
+//
+// r is needed (rather than just the secret and allow list) so
+// authenticated can be keyed on r.connRegistry's connection ids, which
+// are never reused, and evicted via OnClose once a connection actually
+// closes — a pointer address would eventually be reused by an unrelated
+// connection, and would otherwise never be evicted at all.
+func AuthMiddleware(r *Router, secret string, allow AuthAllowList) Middleware {
+	var authenticated sync.Map // connID (string) -> struct{}
+
+	r.connRegistry.OnClose(func(connID string) {
+		authenticated.Delete(connID)
+	})
+
+	return func(next RequestHandler) RequestHandler {
+		return func(rc *RequestContext) (interface{}, error) {
+			if _, ok := authenticated.Load(rc.connID); ok {
+				return next(rc)
+			}
+
+			var params authHandshakeParams
+			if rc.Params != nil {
+				// best-effort: most methods don't carry an Authorization
+				// field, that's expected and not an error
+				json.Unmarshal(*rc.Params, &params)
+			}
+
+			// constant-time: this is a shared-secret comparison, and
+			// Authorization is attacker-controlled.
+			secretMatches := params.Authorization != "" &&
+				subtle.ConstantTimeCompare([]byte(params.Authorization), []byte(secret)) == 1
+
+			if secretMatches {
+				authenticated.Store(rc.connID, struct{}{})
+				return next(rc)
+			}
+
+			if allow[rc.Method] {
+				return next(rc)
+			}
+
+			return nil, StandardRpcError(jsonrpc2.CodeInvalidRequest)
+		}
+	}
+}
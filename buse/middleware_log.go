@@ -0,0 +1,52 @@
+package buse
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type requestLogParams struct {
+	ProfileID int64 `json:"profileId"`
+}
+
+// RequestLogNotification is sent to the client after every dispatched
+// call when LoggingMiddleware is in use.
+type RequestLogNotification struct {
+	Method     string  `json:"method"`
+	DurationMS float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+	ProfileID  int64   `json:"profileId,omitempty"`
+}
+
+// LoggingMiddleware emits a "Log.Request" notification after every call,
+// carrying the method, how long it took, whether it errored, and the
+// calling profile (when the params carry a profileId). Lets a UI show
+// recent activity without scraping butler's own --verbose output.
+func LoggingMiddleware() Middleware {
+	return func(next RequestHandler) RequestHandler {
+		return func(rc *RequestContext) (interface{}, error) {
+			start := time.Now()
+			res, err := next(rc)
+			duration := time.Since(start)
+
+			var params requestLogParams
+			if rc.Params != nil {
+				// best-effort: not every method's params carry a
+				// profileId, that's fine, we just log 0 for those
+				json.Unmarshal(*rc.Params, &params)
+			}
+
+			notif := &RequestLogNotification{
+				Method:     rc.Method,
+				DurationMS: duration.Seconds() * 1000,
+				ProfileID:  params.ProfileID,
+			}
+			if err != nil {
+				notif.Error = err.Error()
+			}
+			rc.Notify("Log.Request", notif)
+
+			return res, err
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package buse
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket is a minimal token-bucket rate limiter: it holds at most
+// capacity tokens, refilling at refillPerSec tokens/second, and Allow
+// reports whether a token was available (consuming it if so).
+type tokenBucket struct {
+	mu           sync.Mutex
+	tokens       float64
+	capacity     float64
+	refillPerSec float64
+	last         time.Time
+}
+
+func newTokenBucket(capacity float64, refillPerSec float64) *tokenBucket {
+	return &tokenBucket{
+		tokens:       capacity,
+		capacity:     capacity,
+		refillPerSec: refillPerSec,
+		last:         time.Now(),
+	}
+}
+
+func (tb *tokenBucket) Allow() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.refillPerSec
+	if tb.tokens > tb.capacity {
+		tb.tokens = tb.capacity
+	}
+	tb.last = now
+
+	if tb.tokens < 1 {
+		return false
+	}
+
+	tb.tokens--
+	return true
+}
+
+// RateLimitMiddleware keeps an untrusted local client from hammering
+// methods matched by limited (e.g. every "Fetch.*" call): each matched
+// method gets its own token bucket of capacity tokens, refilling at
+// refillPerSec tokens/second, shared across every connection since a
+// hammering client is the threat regardless of which socket it's on.
+func RateLimitMiddleware(capacity float64, refillPerSec float64, limited func(method string) bool) Middleware {
+	var buckets sync.Map // method (string) -> *tokenBucket
+
+	return func(next RequestHandler) RequestHandler {
+		return func(rc *RequestContext) (interface{}, error) {
+			if !limited(rc.Method) {
+				return next(rc)
+			}
+
+			bucketI, _ := buckets.LoadOrStore(rc.Method, newTokenBucket(capacity, refillPerSec))
+			if !bucketI.(*tokenBucket).Allow() {
+				return nil, StandardRpcError(CodeRateLimited)
+			}
+
+			return next(rc)
+		}
+	}
+}
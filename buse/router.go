@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/itchio/butler/database"
 	"github.com/itchio/butler/progress"
@@ -18,6 +21,15 @@ import (
 	"github.com/sourcegraph/jsonrpc2"
 )
 
+// CodeRequestCancelled is sent back to the client when a request is
+// cancelled before it could complete because it blew through its
+// deadline or idle timeout.
+const CodeRequestCancelled jsonrpc2.Code = -32000
+
+// CodeRateLimited is sent back to the client when a method guarded by
+// RateLimitMiddleware is called more often than its token bucket allows.
+const CodeRateLimited jsonrpc2.Code = -32001
+
 type RequestHandler func(rc *RequestContext) (interface{}, error)
 
 type Router struct {
@@ -25,6 +37,100 @@ type Router struct {
 	MansionContext *mansion.Context
 	CancelFuncs    *CancelFuncs
 	openDB         OpenDBFunc
+
+	middlewares []Middleware
+
+	// connRegistry is behind a pointer, like CancelFuncs, since Dispatch
+	// and dispatch take Router by value and a sync.Mutex/sync.Map can't
+	// be copied once used.
+	connRegistry *connRegistry
+}
+
+// connRegistry mints a process-unique, monotonically increasing id for
+// every Transport it sees, so per-connection state (e.g. AuthMiddleware's
+// authenticated set) can be keyed on something that's never reused, and
+// lets interested parties clean that state up via OnClose once the
+// connection actually closes.
+type connRegistry struct {
+	nextID int64
+	ids    sync.Map // connKey(Transport) -> string
+
+	mu    sync.Mutex
+	hooks []func(connID string)
+}
+
+// idFor returns transport's connection id, minting one the first time
+// it's seen. Unlike a pointer address, this id can never be reused once
+// transport is garbage collected. If transport exposes DisconnectNotify,
+// the id (and anything hung off it via OnClose) is forgotten as soon as
+// the connection actually closes, instead of leaking for the life of the
+// process.
+func (cr *connRegistry) idFor(transport Transport) string {
+	if id, ok := cr.ids.Load(connKey(transport)); ok {
+		return id.(string)
+	}
+
+	id := fmt.Sprintf("conn-%d", atomic.AddInt64(&cr.nextID, 1))
+	actual, loaded := cr.ids.LoadOrStore(connKey(transport), id)
+	if !loaded {
+		if dn, ok := transport.(interface{ DisconnectNotify() <-chan struct{} }); ok {
+			go func() {
+				<-dn.DisconnectNotify()
+				cr.close(transport)
+			}()
+		}
+	}
+
+	return actual.(string)
+}
+
+// OnClose registers a hook to run, with the connection's id, once a
+// connection closes. AuthMiddleware uses this to evict its per-connection
+// authenticated flag instead of leaving it keyed against an id that will
+// never be reused but would otherwise never be cleaned up either.
+func (cr *connRegistry) OnClose(hook func(connID string)) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.hooks = append(cr.hooks, hook)
+}
+
+// connKey is what ids is keyed on. Dispatch wraps the same *jsonrpc2.Conn
+// in a fresh jsonrpc2Transport for every request, so those are keyed on
+// the underlying conn to keep one id per connection.
+func connKey(transport Transport) interface{} {
+	if jt, ok := transport.(*jsonrpc2Transport); ok {
+		return jt.conn
+	}
+	return transport
+}
+
+func (cr *connRegistry) close(transport Transport) {
+	idI, ok := cr.ids.Load(connKey(transport))
+	if !ok {
+		return
+	}
+	cr.ids.Delete(connKey(transport))
+
+	cr.mu.Lock()
+	hooks := append([]func(string){}, cr.hooks...)
+	cr.mu.Unlock()
+
+	id := idI.(string)
+	for _, hook := range hooks {
+		hook(id)
+	}
+}
+
+// Middleware wraps a RequestHandler to add cross-cutting behavior (auth,
+// logging, rate-limiting...) without the handler itself knowing about it.
+type Middleware func(RequestHandler) RequestHandler
+
+// Use registers middlewares to run, in order, around every handler.
+// Middlewares are applied at dispatch time, so calling Use at any point
+// affects every request dispatched afterwards, regardless of when the
+// handler itself was registered.
+func (r *Router) Use(mw ...Middleware) {
+	r.middlewares = append(r.middlewares, mw...)
 }
 
 type OpenDBFunc func() (*gorm.DB, error)
@@ -36,6 +142,7 @@ func NewRouter(mansionContext *mansion.Context, openDB OpenDBFunc) *Router {
 		CancelFuncs: &CancelFuncs{
 			Funcs: make(map[string]context.CancelFunc),
 		},
+		connRegistry: &connRegistry{},
 
 		openDB: openDB,
 	}
@@ -48,11 +155,19 @@ func (r *Router) Register(method string, rh RequestHandler) {
 	r.Handlers[method] = rh
 }
 
+// Dispatch handles a request coming in over JSON-RPC 2.0 (the original
+// transport, typically a websocket). It's a thin adapter: GrpcServer
+// (see transport_grpc.go) adapts its own wire format the same way, and
+// both funnel into dispatch, which doesn't know or care which transport
+// it's talking over.
 func (r Router) Dispatch(ctx context.Context, origConn *jsonrpc2.Conn, req *jsonrpc2.Request) {
-	method := req.Method
+	r.dispatch(ctx, &jsonrpc2Transport{origConn}, req.ID, req.Method, req.Params)
+}
+
+func (r Router) dispatch(ctx context.Context, transport Transport, reqID jsonrpc2.ID, method string, rawParams *json.RawMessage) {
 	var res interface{}
 
-	conn := &jsonrpc2Conn{origConn}
+	conn := &transportConn{transport}
 	consumer, cErr := NewStateConsumer(&NewStateConsumerParams{
 		Ctx:  ctx,
 		Conn: conn,
@@ -61,6 +176,14 @@ func (r Router) Dispatch(ctx context.Context, origConn *jsonrpc2.Conn, req *json
 		return
 	}
 
+	replyCtx := ctx
+	reqIDStr := reqID.String()
+	ctx, cancel := context.WithCancel(ctx)
+	r.CancelFuncs.Add(reqIDStr, cancel)
+	defer r.CancelFuncs.Remove(reqIDStr)
+
+	var cancelledByTimeout bool
+
 	err := func() (err error) {
 		defer func() {
 			if r := recover(); r != nil {
@@ -73,6 +196,10 @@ func (r Router) Dispatch(ctx context.Context, origConn *jsonrpc2.Conn, req *json
 		}()
 
 		if h, ok := r.Handlers[method]; ok {
+			for i := len(r.middlewares) - 1; i >= 0; i-- {
+				h = r.middlewares[i](h)
+			}
+
 			var _db *gorm.DB
 			getDB := func() *gorm.DB {
 				if _db == nil {
@@ -100,14 +227,24 @@ func (r Router) Dispatch(ctx context.Context, origConn *jsonrpc2.Conn, req *json
 				Ctx:            ctx,
 				Harness:        NewProductionHarness(),
 				Consumer:       consumer,
-				Params:         req.Params,
+				Method:         method,
+				Params:         rawParams,
 				Conn:           conn,
 				MansionContext: r.MansionContext,
 				CancelFuncs:    r.CancelFuncs,
 				DB:             getDB,
+				id:             reqIDStr,
+				connID:         r.connRegistry.idFor(transport),
+			}
+
+			rc.onTimeout = func() {
+				cancelledByTimeout = true
+				cancel()
 			}
 
 			rc.Consumer.OnProgress = func(alpha float64) {
+				rc.bumpIdleTimeout()
+
 				if rc.counter == nil {
 					// skip
 					return
@@ -137,14 +274,25 @@ func (r Router) Dispatch(ctx context.Context, origConn *jsonrpc2.Conn, req *json
 			}
 
 			res, err = h(rc)
+
+			if rc.deadlineTimer != nil {
+				rc.deadlineTimer.stop()
+			}
+			if rc.idleTimer != nil {
+				rc.idleTimer.stop()
+			}
 		} else {
 			err = StandardRpcError(jsonrpc2.CodeMethodNotFound)
 		}
 		return
 	}()
 
+	if cancelledByTimeout {
+		err = StandardRpcError(CodeRequestCancelled)
+	}
+
 	if err == nil {
-		err = origConn.Reply(ctx, req.ID, res)
+		err = transport.Reply(replyCtx, reqID, res)
 		if err != nil {
 			consumer.Errorf("Error while replying: %s", err.Error())
 		}
@@ -152,7 +300,7 @@ func (r Router) Dispatch(ctx context.Context, origConn *jsonrpc2.Conn, req *json
 	}
 
 	if ee, ok := AsBuseError(err); ok {
-		origConn.ReplyWithError(ctx, req.ID, ee.AsJsonRpc2())
+		transport.ReplyWithError(replyCtx, reqID, ee.AsJsonRpc2())
 		return
 	}
 
@@ -168,7 +316,7 @@ func (r Router) Dispatch(ctx context.Context, origConn *jsonrpc2.Conn, req *json
 			rawData = &rm
 		}
 	}
-	origConn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{
+	transport.ReplyWithError(replyCtx, reqID, &jsonrpc2.Error{
 		Code:    jsonrpc2.CodeInternalError,
 		Message: err.Error(),
 		Data:    rawData,
@@ -179,14 +327,31 @@ type RequestContext struct {
 	Ctx            context.Context
 	Harness        Harness
 	Consumer       *state.Consumer
+	Method         string
 	Params         *json.RawMessage
 	Conn           Conn
 	MansionContext *mansion.Context
 	CancelFuncs    *CancelFuncs
 	DB             DBGetter
 
+	// OperationID, when set by a long-running handler (operate.Start, for
+	// one), identifies this operation across reconnects, unlike id below
+	// which is scoped to a single JSON-RPC request/response pair. It's
+	// what LogStream and Replay key their ring buffer on.
+	OperationID string
+	// StagingFolder, when set, is where LogStream persists its chunks so
+	// they can still be tailed after a butler restart.
+	StagingFolder string
+
 	notificationInterceptors map[string]NotificationInterceptor
 	counter                  *progress.Counter
+
+	id            string
+	connID        string
+	onTimeout     func()
+	deadlineTimer *deadlineTimer
+	idleTimer     *deadlineTimer
+	idleTimeout   time.Duration
 }
 
 type DBGetter func() *gorm.DB
@@ -196,9 +361,41 @@ type WithParamsFunc func() (interface{}, error)
 type NotificationInterceptor func(method string, params interface{}) error
 
 func (rc *RequestContext) Call(method string, params interface{}, res interface{}) error {
+	rc.bumpIdleTimeout()
 	return rc.Conn.Call(rc.Ctx, method, params, res)
 }
 
+// SetDeadline cancels the request if it hasn't completed by t. Calling it
+// again before t replaces the previous deadline. Mansion handlers that
+// support per-install deadlines read this from params (see
+// OperationStartParams.Deadline) and set it as soon as the request context
+// is available.
+func (rc *RequestContext) SetDeadline(t time.Time) {
+	if rc.deadlineTimer == nil {
+		rc.deadlineTimer = newDeadlineTimer(rc.onTimeout)
+	}
+	rc.deadlineTimer.reset(time.Until(t))
+}
+
+// SetIdleTimeout cancels the request if no Notify, Call or progress event
+// happens for d. Every such event pushes the timeout back, so a slow but
+// steadily progressing install is never cancelled, only a hung one.
+func (rc *RequestContext) SetIdleTimeout(d time.Duration) {
+	rc.idleTimeout = d
+	if rc.idleTimer == nil {
+		rc.idleTimer = newDeadlineTimer(rc.onTimeout)
+	}
+	rc.idleTimer.reset(d)
+}
+
+// bumpIdleTimeout resets the idle timeout, if one is set. It's called from
+// Notify, Call, and the progress consumer's OnProgress callback.
+func (rc *RequestContext) bumpIdleTimeout() {
+	if rc.idleTimer != nil {
+		rc.idleTimer.reset(rc.idleTimeout)
+	}
+}
+
 func (rc *RequestContext) InterceptNotification(method string, interceptor NotificationInterceptor) {
 	if rc.notificationInterceptors == nil {
 		rc.notificationInterceptors = make(map[string]NotificationInterceptor)
@@ -214,6 +411,7 @@ func (rc *RequestContext) StopInterceptingNotification(method string) {
 }
 
 func (rc *RequestContext) Notify(method string, params interface{}) error {
+	rc.bumpIdleTimeout()
 	if rc.notificationInterceptors != nil {
 		if ni, ok := rc.notificationInterceptors[method]; ok {
 			return ni(method, params)
@@ -284,24 +482,40 @@ func (rc *RequestContext) EndProgress() {
 	}
 }
 
+// CancelFuncs is shared by every in-flight request on a Router, so Add,
+// Remove and Call can all race against each other: dispatch adds/removes
+// one per request regardless of transport, operate.Start adds its own
+// under the operation id, and the gRPC transport dispatches each
+// incoming envelope on its own goroutine. The map itself is therefore
+// guarded by mu rather than left to the caller to synchronize.
 type CancelFuncs struct {
+	mu    sync.Mutex
 	Funcs map[string]context.CancelFunc
 }
 
 func (cf *CancelFuncs) Add(id string, f context.CancelFunc) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
 	cf.Funcs[id] = f
 }
 
 func (cf *CancelFuncs) Remove(id string) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
 	delete(cf.Funcs, id)
 }
 
 func (cf *CancelFuncs) Call(id string) bool {
-	if f, ok := cf.Funcs[id]; ok {
-		f()
+	cf.mu.Lock()
+	f, ok := cf.Funcs[id]
+	if ok {
 		delete(cf.Funcs, id)
-		return true
+	}
+	cf.mu.Unlock()
+
+	if ok {
+		f()
 	}
 
-	return false
+	return ok
 }
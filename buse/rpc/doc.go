@@ -0,0 +1,7 @@
+// Package rpc holds the generated bindings for buse/butler.proto. It's
+// checked in like the rest of the generated code in this repo, so `go
+// build` works without protoc installed; re-run the generator below
+// whenever butler.proto changes and commit the result alongside it.
+//
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative -I .. ../butler.proto
+package rpc
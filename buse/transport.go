@@ -0,0 +1,73 @@
+package buse
+
+import (
+	"context"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Transport is everything Router.dispatch needs from the underlying wire
+// protocol to answer a request: reply with a result or an error, and, for
+// the duration of the handler, push notifications or make server-to-client
+// calls. jsonrpc2Transport (below) wraps the original JSON-RPC 2.0
+// transport (normally a websocket) to satisfy it; grpcTransport (see
+// transport_grpc.go) wraps a gRPC stream to satisfy it too, so dispatch
+// never needs to know which one it's talking to.
+type Transport interface {
+	Reply(ctx context.Context, id jsonrpc2.ID, result interface{}) error
+	ReplyWithError(ctx context.Context, id jsonrpc2.ID, err *jsonrpc2.Error) error
+	Notify(ctx context.Context, method string, params interface{}) error
+	Call(ctx context.Context, method string, params interface{}, res interface{}) error
+}
+
+// jsonrpc2Transport adapts *jsonrpc2.Conn to Transport. It can't be
+// satisfied directly (`var _ Transport = (*jsonrpc2.Conn)(nil)`, which
+// doesn't compile): Conn.Notify and Conn.Call both take a trailing
+// ...CallOption that Transport has no use for, the same reason the
+// pre-gRPC code kept its own jsonrpc2Conn adapter instead of passing
+// *jsonrpc2.Conn around directly.
+type jsonrpc2Transport struct {
+	conn *jsonrpc2.Conn
+}
+
+var _ Transport = (*jsonrpc2Transport)(nil)
+
+func (t *jsonrpc2Transport) Reply(ctx context.Context, id jsonrpc2.ID, result interface{}) error {
+	return t.conn.Reply(ctx, id, result)
+}
+
+func (t *jsonrpc2Transport) ReplyWithError(ctx context.Context, id jsonrpc2.ID, err *jsonrpc2.Error) error {
+	return t.conn.ReplyWithError(ctx, id, err)
+}
+
+func (t *jsonrpc2Transport) Notify(ctx context.Context, method string, params interface{}) error {
+	return t.conn.Notify(ctx, method, params)
+}
+
+func (t *jsonrpc2Transport) Call(ctx context.Context, method string, params interface{}, res interface{}) error {
+	return t.conn.Call(ctx, method, params, res)
+}
+
+// DisconnectNotify passes through *jsonrpc2.Conn's own so connRegistry
+// (see router.go) can still evict this connection's id as soon as it
+// closes, the same as it would for a bare *jsonrpc2.Conn.
+func (t *jsonrpc2Transport) DisconnectNotify() <-chan struct{} {
+	return t.conn.DisconnectNotify()
+}
+
+// transportConn narrows a Transport down to the Conn interface (Notify
+// and Call only) that's handed to handlers via RequestContext.Conn.
+// Replying is dispatch's job alone, so it's deliberately left out.
+type transportConn struct {
+	transport Transport
+}
+
+var _ Conn = (*transportConn)(nil)
+
+func (tc *transportConn) Notify(ctx context.Context, method string, params interface{}) error {
+	return tc.transport.Notify(ctx, method, params)
+}
+
+func (tc *transportConn) Call(ctx context.Context, method string, params interface{}, res interface{}) error {
+	return tc.transport.Call(ctx, method, params, res)
+}
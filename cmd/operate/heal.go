@@ -0,0 +1,42 @@
+package operate
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/itchio/butler/buse"
+)
+
+// heal re-verifies the install and re-downloads just the files that
+// don't match, reusing the existing staging folder (and the
+// MetaSubcontext already saved there) so a heal that gets interrupted
+// can resume instead of starting over.
+func heal(oc *OperationContext, meta *MetaSubcontext) (*buse.HealResult, error) {
+	params := meta.data.HealParams
+	if params == nil {
+		return nil, errors.New("Missing heal params")
+	}
+
+	vres, err := verifyInstallFolder(oc, params.InstallFolder)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	toHeal := append([]string{}, vres.MissingFiles...)
+	toHeal = append(toHeal, vres.MismatchedFiles...)
+
+	consumer := oc.consumer
+	if len(toHeal) == 0 {
+		consumer.Infof("Nothing to heal, install is already healthy")
+		return &buse.HealResult{}, nil
+	}
+
+	consumer.Infof("Healing %d files", len(toHeal))
+
+	healed, err := oc.FetchFiles(params.InstallFolder, toHeal)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	return &buse.HealResult{
+		HealedFiles: healed,
+	}, nil
+}
@@ -3,20 +3,37 @@ package operate
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/go-errors/errors"
 	"github.com/itchio/butler/buse"
-	"github.com/itchio/butler/comm"
-	"github.com/itchio/butler/mansion"
 	"github.com/sourcegraph/jsonrpc2"
 )
 
-func Start(ctx context.Context, mansionContext *mansion.Context, conn *jsonrpc2.Conn, params *buse.OperationStartParams) (*buse.OperationResult, error) {
+func Start(rc *buse.RequestContext, conn *jsonrpc2.Conn, params *buse.OperationStartParams) (*buse.OperationResult, error) {
 	if params.StagingFolder == "" {
 		return nil, errors.New("No staging folder specified")
 	}
 
-	oc := LoadContext(conn, ctx, mansionContext, comm.NewStateConsumer(), params.StagingFolder)
+	rc.StagingFolder = params.StagingFolder
+	rc.OperationID = params.ID
+	defer rc.ReleaseLogStreams()
+
+	if params.Deadline != nil {
+		rc.SetDeadline(*params.Deadline)
+	}
+	if params.IdleTimeout > 0 {
+		rc.SetIdleTimeout(time.Duration(params.IdleTimeout * float64(time.Second)))
+	}
+
+	ctx, cancel := context.WithCancel(rc.Ctx)
+	if params.ID != "" {
+		rc.CancelFuncs.Add(params.ID, cancel)
+		defer rc.CancelFuncs.Remove(params.ID)
+	}
+	defer cancel()
+
+	oc := LoadContext(conn, ctx, rc.MansionContext, rc.Consumer, params.StagingFolder)
 
 	meta := &MetaSubcontext{
 		data: params,
@@ -50,8 +67,78 @@ func Start(ctx context.Context, mansionContext *mansion.Context, conn *jsonrpc2.
 				Game:   params.InstallParams.Game,
 				Upload: params.InstallParams.Upload,
 				Build:  params.InstallParams.Build,
+				Files:  ires.Files,
+			},
+		}, nil
+	case "uninstall":
+		ures, err := uninstall(oc, meta)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+
+		err = oc.Retire()
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+
+		return &buse.OperationResult{
+			Success:         true,
+			UninstallResult: ures,
+		}, nil
+	case "update":
+		ires, err := update(oc, meta)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+
+		oc.consumer.Infof("Updated %d files, reporting success", len(ires.Files))
+
+		err = oc.Retire()
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+
+		return &buse.OperationResult{
+			Success: true,
+			InstallResult: &buse.InstallResult{
+				Game:   params.InstallParams.Game,
+				Upload: params.InstallParams.Upload,
+				Build:  params.InstallParams.Build,
+				Files:  ires.Files,
 			},
 		}, nil
+	case "verify":
+		vres, err := verify(oc, meta)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+
+		err = oc.Retire()
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+
+		return &buse.OperationResult{
+			Success:      true,
+			VerifyResult: vres,
+		}, nil
+	case "heal":
+		hres, err := heal(oc, meta)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+
+		oc.consumer.Infof("Healed %d files, reporting success", len(hres.HealedFiles))
+
+		err = oc.Retire()
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+
+		return &buse.OperationResult{
+			Success:    true,
+			HealResult: hres,
+		}, nil
 	}
 
 	return nil, fmt.Errorf("Unknown operation '%s'", params.Operation)
@@ -0,0 +1,44 @@
+package operate
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/go-errors/errors"
+	"github.com/itchio/butler/buse"
+)
+
+// uninstall removes every file recorded by the original install, then
+// deletes the receipt, so a later "install" for this cave starts clean.
+func uninstall(oc *OperationContext, meta *MetaSubcontext) (*buse.UninstallResult, error) {
+	params := meta.data.UninstallParams
+	if params == nil {
+		return nil, errors.New("Missing uninstall params")
+	}
+
+	receipt, err := oc.CurrentReceipt()
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	if receipt == nil {
+		return nil, errors.New("No receipt found, refusing to uninstall")
+	}
+
+	consumer := oc.consumer
+	consumer.Infof("Uninstalling %d files from %s", len(receipt.Files), params.InstallFolder)
+
+	for _, f := range receipt.Files {
+		path := filepath.Join(params.InstallFolder, f)
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			consumer.Warnf("Could not remove %s: %s", path, err.Error())
+		}
+	}
+
+	err = oc.RemoveReceipt(params.InstallFolder)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	return &buse.UninstallResult{}, nil
+}
@@ -0,0 +1,120 @@
+package operate
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/go-errors/errors"
+	"github.com/itchio/wharf/pwr"
+)
+
+// updateResult mirrors the bits of install's result that the caller
+// cares about (the list of files touched), without pulling in the rest
+// of install's bookkeeping.
+type updateResult struct {
+	Files []string
+}
+
+// update diffs the installed build against the latest upload's build and
+// applies a wharf patch, instead of re-downloading and reinstalling the
+// whole upload. Falls back to a full install if no patch is available
+// between the two builds (e.g. the upload was replaced rather than a new
+// build being pushed).
+func update(oc *OperationContext, meta *MetaSubcontext) (*updateResult, error) {
+	params := meta.data.InstallParams
+	if params == nil {
+		return nil, errors.New("Missing install params")
+	}
+
+	consumer := oc.consumer
+
+	receipt, err := oc.CurrentReceipt()
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	if receipt == nil || receipt.Build == nil {
+		consumer.Infof("No usable receipt, falling back to full install")
+		ires, err := install(oc, meta)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		return &updateResult{Files: ires.Files}, nil
+	}
+
+	consumer.Infof("Updating from build %d to build %d", receipt.Build.ID, params.Build.ID)
+
+	patchInfo, err := oc.FindPatch(receipt.Build, params.Build)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	if patchInfo == nil {
+		consumer.Infof("No patch available between these builds, falling back to full install")
+		ires, err := install(oc, meta)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		return &updateResult{Files: ires.Files}, nil
+	}
+
+	actx := &pwr.ApplyContext{
+		TargetPath: params.InstallFolder,
+		OutputPath: params.InstallFolder,
+		Consumer:   consumer,
+	}
+
+	err = actx.ApplyPatch(patchInfo.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	touchedFiles := actx.Stats().TouchedFiles()
+
+	// Bring the receipt left over from the previous build up to date:
+	// the new build id, fresh hashes for every file the patch touched,
+	// and the install folder's current file list (a patch can add or
+	// remove files, not just change their contents). Without this, a
+	// later verify or uninstall would keep comparing against the
+	// pre-patch build, reporting spurious mismatches for every
+	// byte-patched file and missing/orphaning whatever the patch added
+	// or removed.
+	receipt.Build = params.Build
+
+	if receipt.Hashes == nil {
+		receipt.Hashes = make(map[string]string)
+	}
+
+	present := make(map[string]bool, len(receipt.Files))
+	var files []string
+	for _, f := range receipt.Files {
+		if _, err := os.Stat(filepath.Join(params.InstallFolder, f)); os.IsNotExist(err) {
+			delete(receipt.Hashes, f)
+			continue
+		}
+		files = append(files, f)
+		present[f] = true
+	}
+
+	for _, f := range touchedFiles {
+		if !present[f] {
+			files = append(files, f)
+			present[f] = true
+		}
+
+		sum, err := sha1sum(filepath.Join(params.InstallFolder, f))
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		receipt.Hashes[f] = sum
+	}
+
+	receipt.Files = files
+
+	err = oc.SaveReceipt(params.InstallFolder, receipt)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	return &updateResult{Files: touchedFiles}, nil
+}
@@ -0,0 +1,85 @@
+package operate
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-errors/errors"
+	"github.com/itchio/butler/buse"
+)
+
+// verify rehashes every file recorded in the receipt manifest against
+// what's actually on disk and reports anything that doesn't match or is
+// missing outright. It doesn't touch anything, so it's safe to cancel at
+// any point via RequestContext.CancelFuncs.
+func verify(oc *OperationContext, meta *MetaSubcontext) (*buse.VerifyResult, error) {
+	params := meta.data.VerifyParams
+	if params == nil {
+		return nil, errors.New("Missing verify params")
+	}
+
+	return verifyInstallFolder(oc, params.InstallFolder)
+}
+
+// verifyInstallFolder is the part of verify that doesn't care which
+// buse params carried the install folder, so heal can reuse it without
+// requiring a VerifyParams of its own.
+func verifyInstallFolder(oc *OperationContext, installFolder string) (*buse.VerifyResult, error) {
+	receipt, err := oc.CurrentReceipt()
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	if receipt == nil {
+		return nil, errors.New("No receipt found, can't verify")
+	}
+
+	consumer := oc.consumer
+	consumer.Infof("Verifying %d files against receipt", len(receipt.Files))
+
+	res := &buse.VerifyResult{}
+
+	for _, f := range receipt.Files {
+		select {
+		case <-oc.Ctx().Done():
+			return nil, errors.Wrap(oc.Ctx().Err(), 0)
+		default:
+		}
+
+		path := filepath.Join(installFolder, f)
+		sum, err := sha1sum(path)
+		if os.IsNotExist(err) {
+			res.MissingFiles = append(res.MissingFiles, f)
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+
+		expected, ok := receipt.Hashes[f]
+		if ok && sum != expected {
+			res.MismatchedFiles = append(res.MismatchedFiles, f)
+		}
+	}
+
+	consumer.Infof("Verify done: %d missing, %d mismatched", len(res.MissingFiles), len(res.MismatchedFiles))
+
+	return res, nil
+}
+
+func sha1sum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}